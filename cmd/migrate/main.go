@@ -0,0 +1,71 @@
+// Command migrate is the migrate CLI.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gomaps/migrate/migrate"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: migrate <command> [arguments]")
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "diff":
+		err = runDiff(os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+// runDiff implements `migrate diff`: it replays the migrations in
+// -path against a fresh shadow database at -target and reports how its
+// schema differs from the live database at -source.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	source := fs.String("source", "", "connection string of the live database")
+	target := fs.String("target", "", "connection string of the shadow database used for comparison")
+	path := fs.String("path", ".", "directory containing migration files")
+	ext := fs.String("ext", "sql", "migration file extension")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *source == "" || *target == "" {
+		return fmt.Errorf("-source and -target are required")
+	}
+
+	migrations, err := migrate.LoadMigrations(*path, *ext)
+	if err != nil {
+		return err
+	}
+
+	changes, err := migrate.Diff(context.Background(), *source, *target, migrations)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("no schema drift detected")
+		return nil
+	}
+	for _, c := range changes {
+		if c.Detail != "" {
+			fmt.Printf("%s: %s (%s)\n", c.Kind, c.Object, c.Detail)
+		} else {
+			fmt.Printf("%s: %s\n", c.Kind, c.Object)
+		}
+	}
+	return nil
+}
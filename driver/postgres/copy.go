@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gomaps/migrate/file"
+	"github.com/lib/pq"
+)
+
+// copyHeaderPattern matches the header line of a *.data file, e.g.
+// -- COPY users(id,name,email) FROM 'users.csv' DELIMITER ','
+var copyHeaderPattern = regexp.MustCompile(`^-- COPY (\w+)\(([^)]*)\) FROM '([^']*)'(?:\s+DELIMITER\s+'([^']*)')?\s*$`)
+
+// copyDataFileName returns the companion *.data file expected alongside a
+// migration file, e.g. 0001_seed.up.sql -> 0001_seed.up.data.
+func (driver *Driver) copyDataFileName(f file.File) string {
+	return strings.TrimSuffix(f.FileName, "."+driver.FilenameExtension()) + ".data"
+}
+
+// runDataFile looks for f's companion *.data file and, if one exists,
+// bulk-loads it via COPY into the table named in its header line. It
+// runs against exec's transaction so a later failure rolls back both the
+// migration's DDL and the data it seeded.
+func (driver *Driver) runDataFile(exec execer, f file.File) error {
+	path := filepath.Join(f.Path, driver.copyDataFileName(f))
+	in, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	tx, ok := exec.(*sql.Tx)
+	if !ok {
+		return fmt.Errorf("postgres: %s: COPY data seeding requires a transaction, but the transaction mode is \"none\"", path)
+	}
+
+	reader := bufio.NewReader(in)
+	headerLine, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	headerLine = strings.TrimRight(headerLine, "\r\n")
+
+	match := copyHeaderPattern.FindStringSubmatch(headerLine)
+	if match == nil {
+		return fmt.Errorf("postgres: %s: missing or malformed COPY header line", path)
+	}
+
+	table := match[1]
+	var columns []string
+	for _, col := range strings.Split(match[2], ",") {
+		columns = append(columns, strings.TrimSpace(col))
+	}
+	delimiter := ','
+	if match[4] != "" {
+		delimiter = []rune(match[4])[0]
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = delimiter
+	csvReader.FieldsPerRecord = -1
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+		values := make([]interface{}, len(record))
+		for i, v := range record {
+			values[i] = v
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+// Dump writes the contents of each named table to w using COPY ... TO
+// STDOUT, in the order given. It lets tests and tooling round-trip
+// fixtures the same way projects lean on pg_dump in CI to compare schema
+// after migrations.
+func (driver *Driver) Dump(w io.Writer, tables ...string) error {
+	for _, table := range tables {
+		if err := driver.dumpTable(w, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (driver *Driver) dumpTable(w io.Writer, table string) error {
+	rows, err := driver.db.Query("COPY " + pq.QuoteIdentifier(table) + " TO STDOUT")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line []byte
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,45 @@
+package postgres
+
+import "testing"
+
+func TestCopyHeaderPattern(t *testing.T) {
+	cases := []struct {
+		name      string
+		header    string
+		wantTable string
+		wantCols  string
+		wantDelim string
+	}{
+		{
+			name:      "default delimiter",
+			header:    "-- COPY users(id,name,email) FROM 'users.csv'",
+			wantTable: "users",
+			wantCols:  "id,name,email",
+		},
+		{
+			name:      "explicit delimiter",
+			header:    "-- COPY users(id,name) FROM 'users.tsv' DELIMITER '\t'",
+			wantTable: "users",
+			wantCols:  "id,name",
+			wantDelim: "\t",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			match := copyHeaderPattern.FindStringSubmatch(c.header)
+			if match == nil {
+				t.Fatalf("header %q did not match", c.header)
+			}
+			if match[1] != c.wantTable {
+				t.Errorf("got table %q, want %q", match[1], c.wantTable)
+			}
+			if match[2] != c.wantCols {
+				t.Errorf("got columns %q, want %q", match[2], c.wantCols)
+			}
+			if match[4] != c.wantDelim {
+				t.Errorf("got delimiter %q, want %q", match[4], c.wantDelim)
+			}
+		})
+	}
+}
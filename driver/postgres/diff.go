@@ -0,0 +1,287 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/gomaps/migrate/file"
+	"github.com/gomaps/migrate/migrate/direction"
+)
+
+// Change kinds returned by Diff.
+const (
+	ChangeTableAdded        = "table_added"
+	ChangeTableDropped      = "table_dropped"
+	ChangeColumnAdded       = "column_added"
+	ChangeColumnDropped     = "column_dropped"
+	ChangeColumnTypeChanged = "column_type_changed"
+	ChangeIndexAdded        = "index_added"
+	ChangeIndexDropped      = "index_dropped"
+	ChangeConstraintAdded   = "constraint_added"
+	ChangeConstraintDropped = "constraint_dropped"
+)
+
+// SchemaChange describes one difference found by Diff between a shadow
+// database (all known migrations applied to a fresh database) and this
+// driver's live database. Object is a table name, "table.column" for
+// column-level changes, or an index or constraint name for index- and
+// constraint-level changes.
+type SchemaChange struct {
+	Kind   string
+	Object string
+	Detail string
+}
+
+// schemaSnapshot is a structural summary of a database's public schema,
+// used to diff two databases. Snapshots parsed from pg_dump record a
+// column's type together with modifiers such as NOT NULL, and a
+// constraint's type as its first keyword (e.g. "PRIMARY"), while
+// information_schema snapshots record the bare data type and the full
+// constraint type (e.g. "PRIMARY KEY"); diffSnapshots compares these
+// strings as they are.
+type schemaSnapshot struct {
+	tables      map[string]map[string]string // table -> column -> column type as recorded by the snapshot source
+	indexes     map[string]string            // index name -> definition
+	constraints map[string]string            // constraint name -> "table:type"
+}
+
+// Diff applies every "up" file in migrations, in order, to a fresh shadow
+// database at targetURL, then compares its resulting schema against this
+// driver's live database and reports what has drifted. This catches the
+// "someone edited a migration after it shipped" and "manual hotfix on
+// the live database" classes of bugs: whatever the migrations produce
+// from scratch is ground truth, and anything else is a SchemaChange.
+func (driver *Driver) Diff(ctx context.Context, targetURL string, migrations []file.File) ([]SchemaChange, error) {
+	shadow := &Driver{}
+	if err := shadow.Initialize(targetURL); err != nil {
+		return nil, err
+	}
+	defer shadow.Close()
+
+	if err := shadow.replay(migrations); err != nil {
+		return nil, err
+	}
+
+	shadowSnap, err := driver.snapshot(ctx, shadow.sourceURL, shadow.db)
+	if err != nil {
+		return nil, err
+	}
+
+	liveSnap, err := driver.snapshot(ctx, driver.sourceURL, driver.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSnapshots(shadowSnap, liveSnap), nil
+}
+
+// replay applies every "up" file in migrations, in order, against
+// driver. It is used to bring a fresh shadow database up to the same
+// version as the live one before diffing them.
+func (driver *Driver) replay(migrations []file.File) error {
+	for _, f := range migrations {
+		if f.Direction != direction.Up {
+			continue
+		}
+
+		pipe := make(chan interface{})
+		go driver.Migrate(f, pipe)
+		for item := range pipe {
+			if err, ok := item.(error); ok {
+				return fmt.Errorf("postgres: replaying %s on shadow database: %v", f.FileName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// snapshot takes a structural snapshot of db, preferring to stream
+// `pg_dump --schema-only` when the binary is on PATH and falling back to
+// walking information_schema/pg_indexes otherwise.
+func (driver *Driver) snapshot(ctx context.Context, url string, db *sql.DB) (schemaSnapshot, error) {
+	if _, err := exec.LookPath("pg_dump"); err == nil {
+		if snap, err := snapshotViaPgDump(ctx, url); err == nil {
+			return snap, nil
+		}
+	}
+	return snapshotViaInformationSchema(ctx, db)
+}
+
+func snapshotViaPgDump(ctx context.Context, url string) (schemaSnapshot, error) {
+	cmd := exec.CommandContext(ctx, "pg_dump", "--schema-only", url)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return schemaSnapshot{}, err
+	}
+	return parsePgDumpSchema(out.String()), nil
+}
+
+var (
+	createTablePattern   = regexp.MustCompile(`(?is)CREATE TABLE (?:public\.)?"?(\w+)"?\s*\(([^;]*?)\)\s*;`)
+	columnLinePattern    = regexp.MustCompile(`^\s*"?(\w+)"?\s+([\w\s(),]+?),?\s*$`)
+	createIndexPattern   = regexp.MustCompile(`(?im)^CREATE(?: UNIQUE)? INDEX (\w+) ON.*$`)
+	addConstraintPattern = regexp.MustCompile(`(?im)ALTER TABLE (?:ONLY )?(?:public\.)?"?(\w+)"?\s+ADD CONSTRAINT (\w+) (\w+)`)
+)
+
+// parsePgDumpSchema extracts table/column/index/constraint definitions
+// from the schema-only SQL pg_dump produces. It is a light parser, not a
+// full SQL grammar, but the DDL pg_dump emits is regular enough that
+// this is enough to diff two schemas.
+func parsePgDumpSchema(dump string) schemaSnapshot {
+	snap := newSchemaSnapshot()
+
+	for _, m := range createTablePattern.FindAllStringSubmatch(dump, -1) {
+		table, body := m[1], m[2]
+		columns := make(map[string]string)
+		for _, line := range strings.Split(body, "\n") {
+			if cm := columnLinePattern.FindStringSubmatch(line); cm != nil {
+				columns[cm[1]] = strings.TrimSpace(cm[2])
+			}
+		}
+		snap.tables[table] = columns
+	}
+
+	for _, line := range createIndexPattern.FindAllString(dump, -1) {
+		name := createIndexPattern.FindStringSubmatch(line)[1]
+		snap.indexes[name] = strings.TrimSpace(line)
+	}
+
+	for _, m := range addConstraintPattern.FindAllStringSubmatch(dump, -1) {
+		snap.constraints[m[2]] = m[1] + ":" + m[3]
+	}
+
+	return snap
+}
+
+func snapshotViaInformationSchema(ctx context.Context, db *sql.DB) (schemaSnapshot, error) {
+	snap := newSchemaSnapshot()
+
+	columnRows, err := db.QueryContext(ctx, `
+		SELECT table_name, column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = 'public'
+		ORDER BY table_name, ordinal_position`)
+	if err != nil {
+		return snap, err
+	}
+	defer columnRows.Close()
+	for columnRows.Next() {
+		var table, column, dataType string
+		if err := columnRows.Scan(&table, &column, &dataType); err != nil {
+			return snap, err
+		}
+		if snap.tables[table] == nil {
+			snap.tables[table] = make(map[string]string)
+		}
+		snap.tables[table][column] = dataType
+	}
+	if err := columnRows.Err(); err != nil {
+		return snap, err
+	}
+
+	indexRows, err := db.QueryContext(ctx, `SELECT indexname, indexdef FROM pg_indexes WHERE schemaname = 'public'`)
+	if err != nil {
+		return snap, err
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var name, def string
+		if err := indexRows.Scan(&name, &def); err != nil {
+			return snap, err
+		}
+		snap.indexes[name] = def
+	}
+	if err := indexRows.Err(); err != nil {
+		return snap, err
+	}
+
+	constraintRows, err := db.QueryContext(ctx, `
+		SELECT constraint_name, table_name, constraint_type
+		FROM information_schema.table_constraints
+		WHERE table_schema = 'public'`)
+	if err != nil {
+		return snap, err
+	}
+	defer constraintRows.Close()
+	for constraintRows.Next() {
+		var name, table, kind string
+		if err := constraintRows.Scan(&name, &table, &kind); err != nil {
+			return snap, err
+		}
+		snap.constraints[name] = table + ":" + kind
+	}
+	return snap, constraintRows.Err()
+}
+
+func newSchemaSnapshot() schemaSnapshot {
+	return schemaSnapshot{
+		tables:      make(map[string]map[string]string),
+		indexes:     make(map[string]string),
+		constraints: make(map[string]string),
+	}
+}
+
+// diffSnapshots reports the changes that turn `from` into `to`: objects
+// present in `to` but not `from` are "added", objects present in `from`
+// but not `to` are "dropped".
+func diffSnapshots(from, to schemaSnapshot) []SchemaChange {
+	var changes []SchemaChange
+
+	for table, columns := range to.tables {
+		fromColumns, ok := from.tables[table]
+		if !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeTableAdded, Object: table})
+			continue
+		}
+		for column, dataType := range columns {
+			fromType, ok := fromColumns[column]
+			if !ok {
+				changes = append(changes, SchemaChange{Kind: ChangeColumnAdded, Object: table + "." + column, Detail: dataType})
+				continue
+			}
+			if fromType != dataType {
+				changes = append(changes, SchemaChange{Kind: ChangeColumnTypeChanged, Object: table + "." + column, Detail: fmt.Sprintf("%s -> %s", fromType, dataType)})
+			}
+		}
+		for column := range fromColumns {
+			if _, ok := columns[column]; !ok {
+				changes = append(changes, SchemaChange{Kind: ChangeColumnDropped, Object: table + "." + column})
+			}
+		}
+	}
+	for table := range from.tables {
+		if _, ok := to.tables[table]; !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeTableDropped, Object: table})
+		}
+	}
+
+	for name, def := range to.indexes {
+		if _, ok := from.indexes[name]; !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeIndexAdded, Object: name, Detail: def})
+		}
+	}
+	for name := range from.indexes {
+		if _, ok := to.indexes[name]; !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeIndexDropped, Object: name})
+		}
+	}
+
+	for name, detail := range to.constraints {
+		if _, ok := from.constraints[name]; !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeConstraintAdded, Object: name, Detail: detail})
+		}
+	}
+	for name := range from.constraints {
+		if _, ok := to.constraints[name]; !ok {
+			changes = append(changes, SchemaChange{Kind: ChangeConstraintDropped, Object: name})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import "testing"
+
+func TestDiffSnapshots(t *testing.T) {
+	from := newSchemaSnapshot()
+	from.tables["users"] = map[string]string{"id": "integer", "email": "text"}
+	from.indexes["users_email_idx"] = "CREATE INDEX users_email_idx ON users (email)"
+
+	to := newSchemaSnapshot()
+	to.tables["users"] = map[string]string{"id": "bigint", "name": "text"}
+	to.tables["orders"] = map[string]string{"id": "integer"}
+
+	changes := diffSnapshots(from, to)
+
+	has := func(kind, object string) bool {
+		for _, c := range changes {
+			if c.Kind == kind && c.Object == object {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !has(ChangeTableAdded, "orders") {
+		t.Error("expected orders to be reported as an added table")
+	}
+	if !has(ChangeColumnAdded, "users.name") {
+		t.Error("expected users.name to be reported as an added column")
+	}
+	if !has(ChangeColumnDropped, "users.email") {
+		t.Error("expected users.email to be reported as a dropped column")
+	}
+	if !has(ChangeColumnTypeChanged, "users.id") {
+		t.Error("expected users.id to be reported as a type change")
+	}
+	if !has(ChangeIndexDropped, "users_email_idx") {
+		t.Error("expected users_email_idx to be reported as a dropped index")
+	}
+}
+
+func TestParsePgDumpSchema(t *testing.T) {
+	dump := `
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    email text
+);
+
+CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email);
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+`
+	snap := parsePgDumpSchema(dump)
+
+	if _, ok := snap.tables["users"]; !ok {
+		t.Fatalf("expected users table to be parsed, got %#v", snap.tables)
+	}
+	if got := snap.tables["users"]["id"]; got != "integer NOT NULL" {
+		t.Errorf("got id column type %q", got)
+	}
+	if _, ok := snap.indexes["users_email_idx"]; !ok {
+		t.Errorf("expected users_email_idx index to be parsed, got %#v", snap.indexes)
+	}
+	if got := snap.constraints["users_pkey"]; got != "users:PRIMARY" {
+		t.Errorf("got constraint %q, want %q", got, "users:PRIMARY")
+	}
+}
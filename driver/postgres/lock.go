@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// ErrLocked is returned by Initialize when the advisory lock guarding
+// concurrent migration runs could not be acquired before x-lock-timeout
+// elapsed. Callers can use it to distinguish "someone else is migrating
+// right now" from other Initialize failures and back off accordingly.
+var ErrLocked = errors.New("postgres: could not acquire advisory lock, another migration may be in progress")
+
+// defaultLockTimeout is used when x-lock-timeout is not set.
+const defaultLockTimeout = 15 * time.Second
+
+// lockPollInterval is how often acquireLock retries pg_try_advisory_lock
+// while waiting for x-lock-timeout to elapse.
+const lockPollInterval = 250 * time.Millisecond
+
+// lockKey derives a stable pg_advisory_lock key from the database name
+// and migrations table, so concurrent instances of the same application
+// race on the same lock while unrelated applications sharing a cluster
+// don't collide.
+func lockKey(database, table string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(database + "." + table))
+	return int64(h.Sum64())
+}
+
+// acquireLock takes the session-level advisory lock that guards
+// Initialize and Migrate against concurrent migration runs, e.g. when
+// several instances of an application boot at once. pg_advisory_lock is
+// scoped to the backend session that took it, so the lock is held
+// through a single *sql.Conn reserved from the pool for the driver's
+// lifetime rather than through driver.db, which could hand the
+// try/release calls to two different backend sessions. acquireLock polls
+// pg_try_advisory_lock rather than blocking on pg_advisory_lock so it can
+// give up with ErrLocked once lockTimeout elapses.
+func (driver *Driver) acquireLock() error {
+	ctx, cancel := context.WithTimeout(context.Background(), driver.lockTimeout)
+	defer cancel()
+
+	conn, err := driver.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	var database string
+	if err := conn.QueryRowContext(ctx, "SELECT current_database()").Scan(&database); err != nil {
+		conn.Close()
+		return err
+	}
+	driver.lockKey = lockKey(database, driver.tableName())
+
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", driver.lockKey).Scan(&locked); err != nil {
+			conn.Close()
+			if ctx.Err() != nil {
+				return ErrLocked
+			}
+			return err
+		}
+		if locked {
+			driver.lockConn = conn
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return ErrLocked
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// releaseLock releases the advisory lock taken by acquireLock and returns
+// its reserved connection to the pool. It is a no-op if the lock was
+// never acquired.
+func (driver *Driver) releaseLock() error {
+	if driver.lockConn == nil {
+		return nil
+	}
+	conn := driver.lockConn
+	driver.lockConn = nil
+
+	var unlocked bool
+	err := conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", driver.lockKey).Scan(&unlocked)
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if !unlocked {
+		return fmt.Errorf("postgres: pg_advisory_unlock(%d) reported no lock was held", driver.lockKey)
+	}
+	return nil
+}
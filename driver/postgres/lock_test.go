@@ -0,0 +1,21 @@
+package postgres
+
+import "testing"
+
+func TestLockKeyIsStableAndDistinct(t *testing.T) {
+	a := lockKey("myapp", "schema_version")
+	b := lockKey("myapp", "schema_version")
+	if a != b {
+		t.Fatalf("lockKey is not deterministic: %d != %d", a, b)
+	}
+
+	c := lockKey("myapp", "other_table")
+	if a == c {
+		t.Fatalf("lockKey collided for different tables: %d", a)
+	}
+
+	d := lockKey("otherapp", "schema_version")
+	if a == d {
+		t.Fatalf("lockKey collided for different databases: %d", a)
+	}
+}
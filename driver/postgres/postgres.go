@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	nurl "net/url"
 	"os/user"
 	"strconv"
+	"time"
 
 	"github.com/gomaps/migrate/file"
 	"github.com/gomaps/migrate/migrate/direction"
@@ -15,12 +17,96 @@ import (
 
 type Driver struct {
 	db *sql.DB
+
+	// statementMode controls whether a migration file's content is sent
+	// to Postgres whole, or split into individual statements. Set from
+	// the x-statement-mode URL query parameter in Initialize.
+	statementMode statementMode
+
+	// migrationsTable and migrationsSchema locate the schema-version
+	// table. They default to defaultTableName and the connection's
+	// default search_path, and can be overridden with the
+	// x-migrations-table and x-migrations-schema URL query parameters.
+	migrationsTable  string
+	migrationsSchema string
+
+	// lockTimeout and lockKey back the advisory lock acquired in
+	// Initialize and released in Close. lockTimeout defaults to
+	// defaultLockTimeout and can be overridden with the x-lock-timeout
+	// URL query parameter.
+	lockTimeout time.Duration
+	lockKey     int64
+	lockConn    *sql.Conn
+
+	// transactionMode is the driver-wide default transaction mode, used
+	// when a migration file carries no migrate:transaction directive of
+	// its own. Set from the x-transaction-mode URL query parameter.
+	transactionMode transactionMode
+
+	// batchTx is the transaction opened by BeginBatch and used by files
+	// whose transaction mode is "batch".
+	batchTx *sql.Tx
+
+	// sourceURL is the (x- parameter stripped) connection string this
+	// driver was initialized with. Diff shells out to pg_dump with it
+	// when pg_dump is available.
+	sourceURL string
 }
 
-const tableName = "schema_version"
+const defaultTableName = "schema_version"
 
 func (driver *Driver) Initialize(url string) error {
-	db, err := sql.Open("postgres", url)
+	purl, err := nurl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	query := purl.Query()
+	mode := statementMode(query.Get("x-statement-mode"))
+	switch mode {
+	case "":
+		driver.statementMode = statementModeWhole
+	case statementModeWhole, statementModeSplit:
+		driver.statementMode = mode
+	default:
+		return fmt.Errorf("unknown x-statement-mode %q", mode)
+	}
+	query.Del("x-statement-mode")
+
+	driver.migrationsTable = defaultTableName
+	if table := query.Get("x-migrations-table"); table != "" {
+		driver.migrationsTable = table
+	}
+	query.Del("x-migrations-table")
+
+	driver.migrationsSchema = query.Get("x-migrations-schema")
+	query.Del("x-migrations-schema")
+
+	driver.lockTimeout = defaultLockTimeout
+	if timeout := query.Get("x-lock-timeout"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid x-lock-timeout %q: %v", timeout, err)
+		}
+		driver.lockTimeout = d
+	}
+	query.Del("x-lock-timeout")
+
+	driver.transactionMode = transactionModeSingle
+	if mode := transactionMode(query.Get("x-transaction-mode")); mode != "" {
+		switch mode {
+		case transactionModeNone, transactionModeSingle, transactionModeBatch:
+			driver.transactionMode = mode
+		default:
+			return fmt.Errorf("unknown x-transaction-mode %q", mode)
+		}
+	}
+	query.Del("x-transaction-mode")
+
+	purl.RawQuery = query.Encode()
+	driver.sourceURL = purl.String()
+
+	db, err := sql.Open("postgres", purl.String())
 	if err != nil {
 		return err
 	}
@@ -29,13 +115,31 @@ func (driver *Driver) Initialize(url string) error {
 	}
 	driver.db = db
 
+	if err := driver.acquireLock(); err != nil {
+		driver.db.Close()
+		return err
+	}
+
 	if err := driver.ensureVersionTableExists(); err != nil {
+		driver.releaseLock()
 		return err
 	}
 	return nil
 }
 
+// tableName returns the schema-version table name, qualified with the
+// configured schema if one was given via x-migrations-schema.
+func (driver *Driver) tableName() string {
+	if driver.migrationsSchema == "" {
+		return driver.migrationsTable
+	}
+	return driver.migrationsSchema + "." + driver.migrationsTable
+}
+
 func (driver *Driver) Close() error {
+	if err := driver.releaseLock(); err != nil {
+		return err
+	}
 	if err := driver.db.Close(); err != nil {
 		return err
 	}
@@ -43,7 +147,13 @@ func (driver *Driver) Close() error {
 }
 
 func (driver *Driver) ensureVersionTableExists() error {
-	if _, err := driver.db.Exec("CREATE TABLE IF NOT EXISTS " + tableName + `
+	if driver.migrationsSchema != "" {
+		if _, err := driver.db.Exec("CREATE SCHEMA IF NOT EXISTS " + driver.migrationsSchema); err != nil {
+			return err
+		}
+	}
+
+	if _, err := driver.db.Exec("CREATE TABLE IF NOT EXISTS " + driver.tableName() + `
 	(
 		version int not null primary key,
 		version_rank int, 
@@ -65,74 +175,167 @@ func (driver *Driver) FilenameExtension() string {
 	return "sql"
 }
 
+// recordPending writes f's schema-version row with success=false before
+// its statements run, for migrations in transactionModeNone. Those run
+// directly against driver.db with no transaction to roll the row back
+// if they're interrupted partway, so Migrate marks the row successful
+// itself once everything has actually succeeded; until then, Repair can
+// find and clean up a row left behind by an interrupted run.
+func (driver *Driver) recordPending(f file.File) error {
+	user, err := user.Current()
+	if err != nil {
+		return err
+	}
+
+	q := "INSERT INTO " + driver.tableName()
+	q += " (version, version_rank, installed_rank, description, type, script, checksum, installed_by, execution_time, success)"
+	q += " VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	q += " ON CONFLICT (version) DO UPDATE SET checksum = EXCLUDED.checksum, success = false"
+	_, err = driver.db.Exec(q, f.Version, f.Rank, f.Rank, f.Name, "SQL", f.FileName, f.Checksum, user.Name, 0, false)
+	return err
+}
+
 func (driver *Driver) Migrate(f file.File, pipe chan interface{}) {
 	defer close(pipe)
 	pipe <- f
 
-	tx, err := driver.db.Begin()
-	if err != nil {
-		pipe <- err
-		return
-	}
-
 	// Read content along with calculating checksum
 	if err := f.ReadContent(); err != nil {
 		pipe <- err
 		return
 	}
 
-	if f.Direction == direction.Up {
-		q := "INSERT INTO " + tableName
-		q += " (version, version_rank, installed_rank, description, type, script, checksum, installed_by, execution_time, success)"
-		q += " VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
-		user, err := user.Current()
+	mode := driver.transactionMode
+	if m, ok := parseTransactionMode(f.Content); ok {
+		mode = m
+	}
+
+	var exec execer
+	var tx *sql.Tx
+	switch mode {
+	case transactionModeNone:
+		exec = driver.db
+	case transactionModeBatch:
+		if driver.batchTx == nil {
+			pipe <- errors.New("postgres: x-transaction-mode=batch requires BeginBatch to be called first")
+			return
+		}
+		exec = driver.batchTx
+	default:
+		var err error
+		tx, err = driver.db.Begin()
 		if err != nil {
 			pipe <- err
 			return
 		}
-		if _, err := tx.Exec(q, f.Version, f.Rank, f.Rank, f.Name, "SQL", f.FileName, f.Checksum, user.Name, 0, true); err != nil {
+		exec = tx
+	}
+
+	if mode == transactionModeNone && f.Direction == direction.Up {
+		if err := driver.recordPending(f); err != nil {
 			pipe <- err
-			if err := tx.Rollback(); err != nil {
-				pipe <- err
-			}
 			return
 		}
-	} else if f.Direction == direction.Down {
-		if _, err := tx.Exec("DELETE FROM "+tableName+" WHERE version=$1", f.Version); err != nil {
-			pipe <- err
-			if err := tx.Rollback(); err != nil {
-				pipe <- err
+	}
+
+	fail := func(err error) {
+		pipe <- err
+		if tx != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				pipe <- rerr
+			}
+		}
+		if mode == transactionModeBatch {
+			if rerr := driver.RollbackBatch(); rerr != nil {
+				pipe <- rerr
+			}
+		}
+	}
+
+	start := time.Now()
+
+	if driver.statementMode == statementModeSplit {
+		for _, stmt := range splitStatements(f.Content) {
+			if _, err := exec.Exec(stmt.text); err != nil {
+				fail(driver.migrationError(err, f.Content, stmt.offset))
+				return
 			}
+		}
+	} else {
+		if _, err := exec.Exec(string(f.Content)); err != nil {
+			fail(driver.migrationError(err, f.Content, 0))
 			return
 		}
 	}
 
-	if _, err := tx.Exec(string(f.Content)); err != nil {
-		pqErr := err.(*pq.Error)
-		offset, err := strconv.Atoi(pqErr.Position)
-		if err == nil && offset >= 0 {
-			lineNo, columnNo := file.LineColumnFromOffset(f.Content, offset-1)
-			errorPart := file.LinesBeforeAndAfter(f.Content, lineNo, 5, 5, true)
-			pipe <- errors.New(fmt.Sprintf("%s %v: %s in line %v, column %v:\n\n%s", pqErr.Severity, pqErr.Code, pqErr.Message, lineNo, columnNo, string(errorPart)))
+	if err := driver.runDataFile(exec, f); err != nil {
+		fail(err)
+		return
+	}
+
+	executionTime := time.Since(start)
+
+	if f.Direction == direction.Up {
+		if mode == transactionModeNone {
+			// recordPending already inserted this version's row; none
+			// mode has no transaction to roll it back if we failed
+			// partway, so finish it off here instead of inserting again.
+			q := "UPDATE " + driver.tableName() + " SET execution_time = $2, success = true WHERE version = $1"
+			if _, err := exec.Exec(q, f.Version, executionTime.Milliseconds()); err != nil {
+				fail(err)
+				return
+			}
 		} else {
-			pipe <- errors.New(fmt.Sprintf("%s %v: %s", pqErr.Severity, pqErr.Code, pqErr.Message))
+			q := "INSERT INTO " + driver.tableName()
+			q += " (version, version_rank, installed_rank, description, type, script, checksum, installed_by, execution_time, success)"
+			q += " VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+			user, err := user.Current()
+			if err != nil {
+				pipe <- err
+				return
+			}
+			if _, err := exec.Exec(q, f.Version, f.Rank, f.Rank, f.Name, "SQL", f.FileName, f.Checksum, user.Name, executionTime.Milliseconds(), true); err != nil {
+				fail(err)
+				return
+			}
+		}
+	} else if f.Direction == direction.Down {
+		if _, err := exec.Exec("DELETE FROM "+driver.tableName()+" WHERE version=$1", f.Version); err != nil {
+			fail(err)
+			return
 		}
+	}
 
-		if err := tx.Rollback(); err != nil {
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
 			pipe <- err
+			return
 		}
-		return
 	}
+}
 
-	if err := tx.Commit(); err != nil {
-		pipe <- err
-		return
+// migrationError turns a driver error raised while executing part of f's
+// content into a descriptive error whose line/column refer back to the
+// original file, accounting for base, the byte offset of the executed
+// statement within that file.
+func (driver *Driver) migrationError(err error, content []byte, base int) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	offset, convErr := strconv.Atoi(pqErr.Position)
+	if convErr == nil && offset >= 0 {
+		lineNo, columnNo := file.LineColumnFromOffset(content, base+offset-1)
+		errorPart := file.LinesBeforeAndAfter(content, lineNo, 5, 5, true)
+		return errors.New(fmt.Sprintf("%s %v: %s in line %v, column %v:\n\n%s", pqErr.Severity, pqErr.Code, pqErr.Message, lineNo, columnNo, string(errorPart)))
 	}
+	return errors.New(fmt.Sprintf("%s %v: %s", pqErr.Severity, pqErr.Code, pqErr.Message))
 }
 
 func (driver *Driver) Version() (int, error) {
 	var version int
-	err := driver.db.QueryRow("SELECT version_rank FROM " + tableName + " ORDER BY version_rank DESC LIMIT 1").Scan(&version)
+	err := driver.db.QueryRow("SELECT version_rank FROM " + driver.tableName() + " WHERE success = true ORDER BY version_rank DESC LIMIT 1").Scan(&version)
 	switch {
 	case err == sql.ErrNoRows:
 		return -1, nil
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// statementMode controls how a migration file's SQL content is executed.
+type statementMode string
+
+const (
+	// statementModeWhole sends the entire file content to Postgres as a
+	// single statement, exactly as the driver has always done. This is
+	// the default, preserving backward compatibility.
+	statementModeWhole statementMode = "whole"
+
+	// statementModeSplit splits the file into individual statements and
+	// executes them one at a time, so a single migration file can mix
+	// plain DDL with functions, DO blocks and other bodies that contain
+	// their own semicolons.
+	statementModeSplit statementMode = "split"
+)
+
+const (
+	statementBeginDirective = "-- +migrate StatementBegin"
+	statementEndDirective   = "-- +migrate StatementEnd"
+)
+
+// statement is a single SQL statement extracted from a migration file,
+// together with the byte offset at which it starts in the original file
+// content. The offset lets callers translate a driver error position
+// (relative to the statement text sent to Postgres) back into a
+// line/column in the original file.
+type statement struct {
+	text   string
+	offset int
+}
+
+// splitStatements splits content into individual statements on ';'
+// boundaries, the same approach the cassandra driver uses, except that
+// text between a statementBeginDirective and statementEndDirective line
+// is kept intact regardless of how many semicolons it contains. This
+// lets migration authors wrap functions, DO blocks and stored
+// procedures in a StatementBegin/StatementEnd pair.
+func splitStatements(content []byte) []statement {
+	var statements []statement
+	var buf bytes.Buffer
+
+	inBlock := false
+	start := 0
+	offset := 0
+
+	// textStart is the offset of buf's text once the leading whitespace
+	// that TrimSpace drops is skipped.
+	textStart := func() int {
+		return start + buf.Len() - len(bytes.TrimLeftFunc(buf.Bytes(), unicode.IsSpace))
+	}
+
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.Equal(trimmed, []byte(statementBeginDirective)) {
+			inBlock = true
+			offset += len(line)
+			continue
+		}
+		if bytes.Equal(trimmed, []byte(statementEndDirective)) {
+			inBlock = false
+			offset += len(line)
+			if text := bytes.TrimSpace(buf.Bytes()); len(text) > 0 {
+				statements = append(statements, statement{text: string(text), offset: textStart()})
+			}
+			buf.Reset()
+			continue
+		}
+
+		if buf.Len() == 0 {
+			start = offset
+		}
+		buf.Write(line)
+		offset += len(line)
+
+		if !inBlock && bytes.ContainsRune(line, ';') {
+			if text := bytes.TrimSpace(buf.Bytes()); len(text) > 0 {
+				statements = append(statements, statement{text: string(text), offset: textStart()})
+			}
+			buf.Reset()
+		}
+	}
+
+	if text := bytes.TrimSpace(buf.Bytes()); len(text) > 0 {
+		statements = append(statements, statement{text: string(text), offset: textStart()})
+	}
+
+	return statements
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import "testing"
+
+func TestSplitStatements(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "plain statements",
+			content: "CREATE TABLE foo (id int);\nCREATE TABLE bar (id int);\n",
+			want: []string{
+				"CREATE TABLE foo (id int);",
+				"CREATE TABLE bar (id int);",
+			},
+		},
+		{
+			name: "statement block followed by a plain statement",
+			content: "-- +migrate StatementBegin\n" +
+				"CREATE FUNCTION f() RETURNS int AS $$\n" +
+				"BEGIN\n" +
+				"  RETURN 1;\n" +
+				"END;\n" +
+				"$$ LANGUAGE plpgsql;\n" +
+				"-- +migrate StatementEnd\n" +
+				"CREATE INDEX idx ON foo(id);\n",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;",
+				"CREATE INDEX idx ON foo(id);",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			statements := splitStatements([]byte(c.content))
+			if len(statements) != len(c.want) {
+				t.Fatalf("got %d statements, want %d: %#v", len(statements), len(c.want), statements)
+			}
+			for i, want := range c.want {
+				if statements[i].text != want {
+					t.Errorf("statement %d: got %q, want %q", i, statements[i].text, want)
+				}
+			}
+		})
+	}
+}
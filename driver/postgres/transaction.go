@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// transactionMode controls how a migration file's statements are wrapped
+// in a transaction.
+type transactionMode string
+
+const (
+	// transactionModeSingle wraps each file in its own transaction. This
+	// is the default, preserving backward compatibility.
+	transactionModeSingle transactionMode = "single"
+
+	// transactionModeNone executes a file's statements directly against
+	// driver.db, outside of any transaction. Required for statements
+	// Postgres refuses to run inside one, such as
+	// CREATE INDEX CONCURRENTLY.
+	transactionModeNone transactionMode = "none"
+
+	// transactionModeBatch executes a file's statements against the
+	// transaction opened by BeginBatch, so several files can be applied
+	// with all-or-nothing semantics across the whole batch.
+	transactionModeBatch transactionMode = "batch"
+)
+
+// transactionDirectivePrefix marks a per-file override of the driver's
+// default transaction mode, e.g. "-- migrate:transaction none".
+const transactionDirectivePrefix = "-- migrate:transaction "
+
+// parseTransactionMode looks for a migrate:transaction directive on the
+// first line of content and reports the mode it names, if any.
+func parseTransactionMode(content []byte) (transactionMode, bool) {
+	line := content
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		line = content[:i]
+	}
+
+	trimmed := strings.TrimSpace(string(line))
+	if !strings.HasPrefix(trimmed, transactionDirectivePrefix) {
+		return "", false
+	}
+
+	switch mode := transactionMode(strings.TrimSpace(strings.TrimPrefix(trimmed, transactionDirectivePrefix))); mode {
+	case transactionModeNone, transactionModeSingle, transactionModeBatch:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx, letting Migrate run
+// statements the same way regardless of which transaction mode is active.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// BeginBatch opens the transaction used by files whose transaction mode
+// is "batch". Callers (migrate core) apply as many files as they like
+// against it and finish with CommitBatch, giving the whole group
+// all-or-nothing semantics.
+func (driver *Driver) BeginBatch() error {
+	if driver.batchTx != nil {
+		return errors.New("postgres: a batch transaction is already in progress")
+	}
+	tx, err := driver.db.Begin()
+	if err != nil {
+		return err
+	}
+	driver.batchTx = tx
+	return nil
+}
+
+// CommitBatch commits the transaction opened by BeginBatch.
+func (driver *Driver) CommitBatch() error {
+	if driver.batchTx == nil {
+		return errors.New("postgres: no batch transaction in progress")
+	}
+	tx := driver.batchTx
+	driver.batchTx = nil
+	return tx.Commit()
+}
+
+// RollbackBatch rolls back the transaction opened by BeginBatch. Migrate
+// calls it itself when a file in the batch fails, but callers that abort
+// a batch for their own reasons (e.g. a later file failed validation
+// before Migrate ever ran) should call it too, since BeginBatch refuses
+// to start a new batch while driver.batchTx is still set.
+func (driver *Driver) RollbackBatch() error {
+	if driver.batchTx == nil {
+		return errors.New("postgres: no batch transaction in progress")
+	}
+	tx := driver.batchTx
+	driver.batchTx = nil
+	return tx.Rollback()
+}
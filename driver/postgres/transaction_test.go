@@ -0,0 +1,47 @@
+package postgres
+
+import "testing"
+
+func TestParseTransactionMode(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    transactionMode
+		wantOK  bool
+	}{
+		{
+			name:    "no directive",
+			content: "CREATE TABLE foo (id int);\n",
+			wantOK:  false,
+		},
+		{
+			name:    "none",
+			content: "-- migrate:transaction none\nCREATE INDEX CONCURRENTLY idx ON foo(id);\n",
+			want:    transactionModeNone,
+			wantOK:  true,
+		},
+		{
+			name:    "batch",
+			content: "-- migrate:transaction batch\nALTER TABLE foo ADD COLUMN bar int;\n",
+			want:    transactionModeBatch,
+			wantOK:  true,
+		},
+		{
+			name:    "unknown mode",
+			content: "-- migrate:transaction bogus\nSELECT 1;\n",
+			wantOK:  false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := parseTransactionMode([]byte(c.content))
+			if ok != c.wantOK {
+				t.Fatalf("got ok=%v, want %v", ok, c.wantOK)
+			}
+			if ok && got != c.want {
+				t.Errorf("got mode %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/gomaps/migrate/file"
+)
+
+// ChecksumMismatch describes a migration whose checksum, as stored in the
+// schema-version table when it was applied, no longer matches the
+// checksum of the file on disk. It is the sign that someone edited an
+// already-applied migration.
+type ChecksumMismatch struct {
+	Version int
+	Stored  int
+	Current int
+}
+
+// Validate re-hashes each of the given migration files and compares the
+// result against the checksum recorded for that version in the
+// schema-version table, matching the workflow Flyway calls "validate".
+// Migrations that have not been applied yet are ignored. The returned
+// slice is empty when every applied migration still matches its stored
+// checksum.
+func (driver *Driver) Validate(migrations []file.File) ([]ChecksumMismatch, error) {
+	rows, err := driver.db.Query("SELECT version, checksum FROM " + driver.tableName() + " WHERE success = true")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[int]int)
+	for rows.Next() {
+		var version, checksum int
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		stored[version] = checksum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var mismatches []ChecksumMismatch
+	for _, f := range migrations {
+		checksum, ok := stored[f.Version]
+		if !ok {
+			continue
+		}
+		if err := f.ReadContent(); err != nil {
+			return nil, err
+		}
+		if checksum != f.Checksum {
+			mismatches = append(mismatches, ChecksumMismatch{
+				Version: f.Version,
+				Stored:  checksum,
+				Current: f.Checksum,
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// Repair deletes schema-version rows left behind by failed migrations
+// (success = false) and re-syncs the stored checksum of every other
+// applied row with the current checksum of its migration file. Use it
+// after fixing a migration that was edited post-apply, or after a
+// transactionModeNone migration run was interrupted mid-way: that mode
+// has no transaction to roll its row back, so Migrate (via
+// recordPending) leaves it success = false until the run actually
+// finishes, for Repair to find. Single and batch mode runs roll their
+// row back along with everything else on failure, so they never need
+// repairing this way.
+func (driver *Driver) Repair(migrations []file.File) error {
+	tx, err := driver.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM " + driver.tableName() + " WHERE success = false"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, f := range migrations {
+		if err := f.ReadContent(); err != nil {
+			tx.Rollback()
+			return err
+		}
+		q := fmt.Sprintf("UPDATE %s SET checksum = $1 WHERE version = $2", driver.tableName())
+		if _, err := tx.Exec(q, f.Checksum, f.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,24 @@
+// Package migrate is the top-level entry point used by the migrate CLI
+// and by applications that embed migration support directly.
+package migrate
+
+import (
+	"context"
+
+	"github.com/gomaps/migrate/driver/postgres"
+	"github.com/gomaps/migrate/file"
+)
+
+// Diff replays migrations against a fresh shadow database at targetURL
+// and compares the result against the live database at sourceURL,
+// reporting what has drifted between them. It backs the `migrate diff`
+// CLI command.
+func Diff(ctx context.Context, sourceURL, targetURL string, migrations []file.File) ([]postgres.SchemaChange, error) {
+	driver := &postgres.Driver{}
+	if err := driver.Initialize(sourceURL); err != nil {
+		return nil, err
+	}
+	defer driver.Close()
+
+	return driver.Diff(ctx, targetURL, migrations)
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomaps/migrate/file"
+	"github.com/gomaps/migrate/migrate/direction"
+)
+
+// LoadMigrations reads every "up" migration file in path whose name ends
+// in ".up."+filenameExtension (as returned by a Driver's
+// FilenameExtension), sorted by the numeric version prefix of its file
+// name. It is used to build the migrations list Diff replays against a
+// shadow database.
+func LoadMigrations(path, filenameExtension string) ([]file.File, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := ".up." + filenameExtension
+	var migrations []file.File
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			continue
+		}
+
+		version, err := versionFromFilename(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %v", entry.Name(), err)
+		}
+
+		migrations = append(migrations, file.File{
+			Path:      path,
+			FileName:  entry.Name(),
+			Version:   version,
+			Name:      strings.TrimSuffix(entry.Name(), suffix),
+			Direction: direction.Up,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := range migrations {
+		migrations[i].Rank = i + 1
+	}
+
+	return migrations, nil
+}
+
+// versionFromFilename extracts the leading numeric version from a
+// migration file name, e.g. "0001_create_users.up.sql" -> 1.
+func versionFromFilename(name string) (int, error) {
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end <= 0 {
+		return 0, fmt.Errorf("file name does not start with a version number")
+	}
+	return strconv.Atoi(name[:end])
+}